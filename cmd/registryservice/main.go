@@ -3,16 +3,55 @@ package main
 import (
 	"context"
 	"distributions/registry"
+	"distributions/registry/gateway"
+	"distributions/registry/rpc"
+	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
 )
 
 func main() {
+	boltPath := flag.String("boltdb", "", "path to a bbolt database file to persist registrations in (defaults to the JSON file store)")
+	jsonPath := flag.String("store", "registry.json", "path to the JSON file used to persist registrations")
+	gatewayAddr := flag.String("gateway", "", "if set, also run a reverse-proxy gateway on this address (e.g. :8080)")
+	grpcAddr := flag.String("grpc", "", "if set, also serve the gRPC transport on this address (e.g. :3001), sharing the same registry as the HTTP API")
+	flag.Parse()
+
+	store, err := openStore(*boltPath, *jsonPath)
+	if err != nil {
+		log.Fatalf("无法打开注册存储 unable to open registration store: %v", err)
+	}
+	registry.SetStore(store)
+
+	// 恢复之前持久化的注册信息，剔除已失效的服务
+	if err := registry.Restore(store); err != nil {
+		log.Printf("恢复注册信息失败 failed to restore registrations: %v", err)
+	}
+
 	// 心跳
 	registry.HandleHeartbeat()
 
+	if *gatewayAddr != "" {
+		if err := startGateway(*gatewayAddr); err != nil {
+			log.Fatalf("无法启动网关 unable to start gateway: %v", err)
+		}
+	}
+
+	if *grpcAddr != "" {
+		if err := startGRPC(*grpcAddr); err != nil {
+			log.Fatalf("无法启动gRPC服务 unable to start gRPC transport: %v", err)
+		}
+	}
+
 	http.Handle("/services", &registry.RegistrationService{})
+	http.Handle("/services/health", &registry.HealthService{})
+	http.Handle("/services/query", &registry.QueryService{})
+	http.Handle("/metrics", promhttp.Handler())
 	var srv http.Server
 	srv.Addr = registry.ExportServerPort
 	ctx, cancel := context.WithCancel(context.Background())
@@ -33,3 +72,48 @@ func main() {
 
 	fmt.Println("关闭服务 Shuting down registry service.")
 }
+
+// openStore picks the bbolt-backed store when boltPath is set, falling
+// back to the default JSON file store at jsonPath otherwise.
+func openStore(boltPath, jsonPath string) (registry.Store, error) {
+	if boltPath != "" {
+		return registry.NewBoltStore(boltPath)
+	}
+	return registry.NewJSONFileStore(jsonPath)
+}
+
+// startGateway registers a gateway.Handler with the hub and serves it on
+// addr, proxying /<serviceName>/... to whichever services it's told about.
+func startGateway(addr string) error {
+	handler := gateway.NewHandler()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_gateway/patch", handler.PatchHandler)
+	mux.HandleFunc("/_gateway/health", handler.HealthHandler)
+	mux.Handle("/", handler)
+
+	go func() {
+		log.Println(http.ListenAndServe(addr, mux))
+	}()
+
+	base := "http://localhost" + addr
+	return gateway.Register(registry.ExportServersUrl, base+"/_gateway/patch", base+"/_gateway/health",
+		[]registry.ServiceName{registry.LogService})
+}
+
+// startGRPC serves registry/rpc.Server on addr, so gRPC dependents reach
+// the exact same in-process hub the HTTP RegistrationService does.
+func startGRPC(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	srv := grpc.NewServer()
+	rpc.RegisterRegistryServer(srv, &rpc.Server{})
+
+	go func() {
+		log.Println(srv.Serve(lis))
+	}()
+	return nil
+}
@@ -0,0 +1,165 @@
+// Package client is what a dependent links against to talk to the
+// registry hub. It transparently prefers the gRPC transport
+// (registry/rpc) when the hub exposes one, falling back to the
+// HTTP/JSON API otherwise, so callers don't need to know which the hub
+// was started with.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"distributions/registry"
+	"distributions/registry/rpc"
+
+	"google.golang.org/grpc"
+)
+
+// Client registers a dependent with the hub and resolves service
+// instances from it.
+type Client struct {
+	httpUrl string
+
+	conn    *grpc.ClientConn
+	rpcConn rpc.RegistryClient
+}
+
+// New returns a Client for the hub's HTTP endpoint at httpUrl (see
+// registry.ExportServersUrl). If grpcAddr is non-empty and can be dialed,
+// Register/Deregister/Resolve are issued over gRPC instead; Watch is only
+// available in that case, since HTTP dependents receive patches via their
+// own ServiceUpdateUrl handler rather than a long-lived stream.
+func New(httpUrl, grpcAddr string) *Client {
+	c := &Client{httpUrl: httpUrl}
+	if grpcAddr == "" {
+		return c
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, grpcAddr, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		return c
+	}
+	c.conn = conn
+	c.rpcConn = rpc.NewRegistryClient(conn)
+	return c
+}
+
+// usingGRPC reports whether grpcAddr was successfully dialed in New.
+func (c *Client) usingGRPC() bool {
+	return c.rpcConn != nil
+}
+
+// Register adds reg to the hub.
+func (c *Client) Register(reg registry.Registration) error {
+	if c.usingGRPC() {
+		required := make([]*rpc.Selector, len(reg.RequiredServices))
+		for i, selector := range reg.RequiredServices {
+			required[i] = &rpc.Selector{
+				Name:              string(selector.Name),
+				VersionConstraint: selector.VersionConstraint,
+				Tags:              selector.Tags,
+			}
+		}
+		_, err := c.rpcConn.Register(context.Background(), &rpc.RegisterRequest{
+			ServiceName:      string(reg.ServiceName),
+			ServiceUrl:       reg.ServiceUrl,
+			RequiredServices: required,
+			HeartbeatUrl:     reg.HeartbeatUrl,
+			Version:          reg.Version,
+			Tags:             reg.Tags,
+			Metadata:         reg.Metadata,
+		})
+		return err
+	}
+
+	body, err := json.Marshal(reg)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(c.httpUrl, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to register with code:%v", resp.StatusCode)
+	}
+	return nil
+}
+
+// Deregister removes the instance at url from the hub.
+func (c *Client) Deregister(url string) error {
+	if c.usingGRPC() {
+		_, err := c.rpcConn.Deregister(context.Background(), &rpc.DeregisterRequest{ServiceUrl: url})
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, c.httpUrl, bytes.NewBufferString(url))
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to deregister with code:%v", resp.StatusCode)
+	}
+	return nil
+}
+
+// Resolve returns the URL of one instance of name, chosen by strategy
+// ("round-robin", "random" or "least-recently-used"; empty defaults to
+// round-robin).
+func (c *Client) Resolve(name registry.ServiceName, strategy registry.Strategy) (string, error) {
+	if strategy == "" {
+		strategy = registry.RoundRobin
+	}
+	if c.usingGRPC() {
+		resp, err := c.rpcConn.Resolve(context.Background(), &rpc.ResolveRequest{
+			ServiceName: string(name),
+			Strategy:    string(strategy),
+		})
+		if err != nil {
+			return "", err
+		}
+		return resp.ServiceUrl, nil
+	}
+
+	url := fmt.Sprintf("%s?name=%s&strategy=%s", c.httpUrl, name, strategy)
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to resolve %v with code:%v", name, resp.StatusCode)
+	}
+	var instance registry.Registration
+	if err := json.NewDecoder(resp.Body).Decode(&instance); err != nil {
+		return "", err
+	}
+	return instance.ServiceUrl, nil
+}
+
+// Watch streams patches for the dependent registered at url. It's only
+// available when the client is using gRPC.
+func (c *Client) Watch(ctx context.Context, url string) (rpc.Registry_WatchClient, error) {
+	if !c.usingGRPC() {
+		return nil, fmt.Errorf("client: Watch requires a gRPC connection")
+	}
+	return c.rpcConn.Watch(ctx, &rpc.WatchRequest{ServiceUrl: url})
+}
+
+// Close releases the underlying gRPC connection, if any.
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
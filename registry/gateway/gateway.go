@@ -0,0 +1,239 @@
+// Package gateway implements a reverse proxy in front of the registry hub:
+// it forwards /<serviceName>/... requests to a healthy instance of
+// serviceName, picked by round-robin across whatever instances the hub
+// currently knows about.
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+
+	"distributions/registry"
+)
+
+// Middleware wraps an http.Handler with additional behavior (auth,
+// rate-limiting, request logging, ...) before a request reaches a proxied
+// instance.
+type Middleware func(http.Handler) http.Handler
+
+// patchEntry and patch mirror the subset of the hub's notification wire
+// format (registry.PatchEntry and registry.Patch) that Handler reads; the
+// other fields of each entry are ignored when decoding.
+type patchEntry struct {
+	Name registry.ServiceName
+	Url  string
+}
+
+type patch struct {
+	Added   []patchEntry
+	Removed []patchEntry
+}
+
+// Handler is a reverse proxy whose routing table is kept current by the
+// hub's patch stream rather than by polling /services.
+type Handler struct {
+	mutex       sync.RWMutex
+	routes      map[registry.ServiceName][]string
+	cursors     map[registry.ServiceName]int
+	middlewares map[registry.ServiceName][]Middleware
+	proxies     map[string]*httputil.ReverseProxy
+}
+
+// NewHandler returns an empty Handler. Call Register to start receiving
+// patches for it.
+func NewHandler() *Handler {
+	return &Handler{
+		routes:      make(map[registry.ServiceName][]string),
+		cursors:     make(map[registry.ServiceName]int),
+		middlewares: make(map[registry.ServiceName][]Middleware),
+		proxies:     make(map[string]*httputil.ReverseProxy),
+	}
+}
+
+// Use installs middleware that wraps every request proxied to name, run in
+// the order given.
+func (h *Handler) Use(name registry.ServiceName, mw ...Middleware) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.middlewares[name] = append(h.middlewares[name], mw...)
+}
+
+// PatchHandler is the http.Handler to register as the gateway's
+// ServiceUpdateUrl; it applies the hub's add/remove patches to the routing
+// table.
+func (h *Handler) PatchHandler(rw http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var p patch
+	if err := json.Unmarshal(body, &p); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, added := range p.Added {
+		h.routes[added.Name] = appendUniqueUrl(h.routes[added.Name], added.Url)
+	}
+	for _, removed := range p.Removed {
+		h.routes[removed.Name] = removeUrl(h.routes[removed.Name], removed.Url)
+		delete(h.proxies, removed.Url)
+	}
+}
+
+// HealthHandler always reports healthy; it exists so the gateway itself
+// has a HeartbeatUrl to give the hub when it registers.
+func (h *Handler) HealthHandler(rw http.ResponseWriter, r *http.Request) {
+	rw.WriteHeader(http.StatusOK)
+}
+
+// ServeHTTP forwards a request for /<serviceName>/rest/of/path to a
+// healthy instance of serviceName, stripping the service prefix first. It
+// responds 503 when no instance is known for that service.
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	name, rest := splitServicePath(r.URL.Path)
+	if name == "" {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	target, ok := h.next(registry.ServiceName(name))
+	if !ok {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	proxy, err := h.proxyFor(target)
+	if err != nil {
+		log.Println(err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var handler http.Handler = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		r.URL.Path = rest
+		proxy.ServeHTTP(rw, r)
+	})
+
+	h.mutex.RLock()
+	middlewares := h.middlewares[registry.ServiceName(name)]
+	h.mutex.RUnlock()
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	handler.ServeHTTP(rw, r)
+}
+
+// proxyFor returns the ReverseProxy for target, creating and caching one
+// the first time target is seen rather than allocating a fresh one per
+// request.
+func (h *Handler) proxyFor(target string) (*httputil.ReverseProxy, error) {
+	h.mutex.RLock()
+	proxy, ok := h.proxies[target]
+	h.mutex.RUnlock()
+	if ok {
+		return proxy, nil
+	}
+
+	targetUrl, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if proxy, ok := h.proxies[target]; ok {
+		return proxy, nil
+	}
+	proxy = httputil.NewSingleHostReverseProxy(targetUrl)
+	h.proxies[target] = proxy
+	return proxy, nil
+}
+
+// next round-robins across the instances currently known for name.
+func (h *Handler) next(name registry.ServiceName) (string, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	urls := h.routes[name]
+	if len(urls) == 0 {
+		return "", false
+	}
+	i := h.cursors[name] % len(urls)
+	h.cursors[name] = i + 1
+	return urls[i], true
+}
+
+// Register tells the hub at registryUrl about this gateway, listing the
+// services it wants to proxy as RequiredServices. The hub immediately
+// replies with the instances it already knows about for those services,
+// then keeps the routing table current by posting patches to updateUrl -
+// no polling required. heartbeatUrl should resolve to h.HealthHandler.
+func Register(registryUrl, updateUrl, heartbeatUrl string, services []registry.ServiceName) error {
+	selectors := make([]registry.Selector, len(services))
+	for i, name := range services {
+		selectors[i] = registry.Selector{Name: name}
+	}
+
+	body, err := json.Marshal(registry.Registration{
+		ServiceName:      "Gateway",
+		ServiceUrl:       updateUrl,
+		RequiredServices: selectors,
+		ServiceUpdateUrl: updateUrl,
+		HeartbeatUrl:     heartbeatUrl,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.Post(registryUrl, "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to register gateway with code:%v", resp.StatusCode)
+	}
+	return nil
+}
+
+func splitServicePath(path string) (name string, rest string) {
+	path = strings.TrimPrefix(path, "/")
+	parts := strings.SplitN(path, "/", 2)
+	name = parts[0]
+	if len(parts) == 2 {
+		rest = "/" + parts[1]
+	} else {
+		rest = "/"
+	}
+	return name, rest
+}
+
+func appendUniqueUrl(urls []string, url string) []string {
+	for _, u := range urls {
+		if u == url {
+			return urls
+		}
+	}
+	return append(urls, url)
+}
+
+func removeUrl(urls []string, url string) []string {
+	out := urls[:0]
+	for _, u := range urls {
+		if u != url {
+			out = append(out, u)
+		}
+	}
+	return out
+}
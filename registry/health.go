@@ -0,0 +1,208 @@
+package registry
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthState is a point in a registration's health state machine:
+// Healthy -> Suspect -> Unhealthy -> Removed. Only reaching Removed causes
+// the instance to be evicted and a Removed patch broadcast, so a single
+// flaky probe can no longer evict a service before its retries even
+// complete.
+type HealthState int
+
+const (
+	Healthy HealthState = iota
+	Suspect
+	Unhealthy
+	Removed
+)
+
+func (s HealthState) String() string {
+	switch s {
+	case Healthy:
+		return "healthy"
+	case Suspect:
+		return "suspect"
+	case Unhealthy:
+		return "unhealthy"
+	case Removed:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
+// HealthPolicy configures how a Registration's instance is probed.
+type HealthPolicy struct {
+	Interval    time.Duration
+	Timeout     time.Duration
+	MaxFailures int
+	BackoffBase time.Duration
+	BackoffCap  time.Duration
+}
+
+var defaultHealthPolicy = HealthPolicy{
+	Interval:    3 * time.Second,
+	Timeout:     time.Second,
+	MaxFailures: 3,
+	BackoffBase: 500 * time.Millisecond,
+	BackoffCap:  30 * time.Second,
+}
+
+// withDefaults fills in any zero-valued field of p from
+// defaultHealthPolicy.
+func (p HealthPolicy) withDefaults() HealthPolicy {
+	d := defaultHealthPolicy
+	if p.Interval > 0 {
+		d.Interval = p.Interval
+	}
+	if p.Timeout > 0 {
+		d.Timeout = p.Timeout
+	}
+	if p.MaxFailures > 0 {
+		d.MaxFailures = p.MaxFailures
+	}
+	if p.BackoffBase > 0 {
+		d.BackoffBase = p.BackoffBase
+	}
+	if p.BackoffCap > 0 {
+		d.BackoffCap = p.BackoffCap
+	}
+	return d
+}
+
+// healthChecker runs one instance's probe loop: on each Interval it calls
+// HeartbeatUrl with a per-request context timeout, and on failure backs
+// off with full jitter (sleep = rand(0, min(cap, base*2^attempt))) rather
+// than retrying immediately, advancing Healthy -> Suspect -> Unhealthy ->
+// Removed only after MaxFailures consecutive failures.
+type healthChecker struct {
+	reg    Registration
+	policy HealthPolicy
+	client *http.Client
+
+	mutex   sync.Mutex
+	state   HealthState
+	failure int
+}
+
+func newHealthChecker(reg Registration) *healthChecker {
+	policy := reg.HealthPolicy.withDefaults()
+	return &healthChecker{
+		reg:    reg,
+		policy: policy,
+		client: &http.Client{Timeout: policy.Timeout},
+		state:  Healthy,
+	}
+}
+
+// State returns the checker's current health state.
+func (c *healthChecker) State() HealthState {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.state
+}
+
+// run drives the probe loop until ctx is cancelled, which happens either
+// when the instance is otherwise removed or once the state machine itself
+// reaches Removed.
+func (c *healthChecker) run(ctx context.Context, r *registry) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.policy.Interval):
+		}
+
+		if c.probe(ctx) {
+			c.recover()
+			continue
+		}
+
+		if c.fail(ctx) {
+			r.remove(c.reg.ServiceUrl)
+			return
+		}
+	}
+}
+
+// probe issues a single GET against HeartbeatUrl bounded by the policy's
+// Timeout, reporting whether it succeeded.
+func (c *healthChecker) probe(ctx context.Context) bool {
+	reqCtx, cancel := context.WithTimeout(ctx, c.policy.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, c.reg.HeartbeatUrl, nil)
+	if err != nil {
+		return false
+	}
+
+	_, span := startOutboundSpan(reqCtx, "registry.healthCheck", req)
+	defer span.End()
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return false
+	}
+	return resp.StatusCode == http.StatusOK
+}
+
+// recover resets the checker back to Healthy after a successful probe.
+func (c *healthChecker) recover() {
+	c.mutex.Lock()
+	wasHealthy := c.state == Healthy
+	c.state = Healthy
+	c.failure = 0
+	c.mutex.Unlock()
+
+	if !wasHealthy {
+		log.Printf("心跳检测恢复 service %v at %s recovered\n", c.reg.ServiceName, c.reg.ServiceUrl)
+	}
+}
+
+// fail records a failed probe, advances the state machine, and - unless
+// the service is now Removed - sleeps out a full-jitter backoff before the
+// next attempt, returning early if ctx is cancelled first. It returns true
+// once MaxFailures has been reached.
+func (c *healthChecker) fail(ctx context.Context) bool {
+	c.mutex.Lock()
+	c.failure++
+	switch {
+	case c.failure >= c.policy.MaxFailures:
+		c.state = Removed
+	case c.failure > 1:
+		c.state = Unhealthy
+	default:
+		c.state = Suspect
+	}
+	state, attempt := c.state, c.failure
+	c.mutex.Unlock()
+
+	log.Printf("心跳检测失败 heartbeat check failed for service %v (state=%v, attempt=%d)\n", c.reg.ServiceName, state, attempt)
+	recordHeartbeatFailure(c.reg.ServiceName)
+
+	if state == Removed {
+		return true
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(fullJitterBackoff(c.policy.BackoffBase, c.policy.BackoffCap, attempt)):
+	}
+	return false
+}
+
+// fullJitterBackoff implements sleep = rand(0, min(backoffCap, base*2^attempt)).
+func fullJitterBackoff(base, backoffCap time.Duration, attempt int) time.Duration {
+	upper := base << uint(attempt)
+	if upper <= 0 || upper > backoffCap {
+		upper = backoffCap
+	}
+	return time.Duration(rand.Int63n(int64(upper) + 1))
+}
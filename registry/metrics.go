@@ -0,0 +1,44 @@
+package registry
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	registrationsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "registry_registrations_total",
+		Help: "Total number of service instances registered with the hub.",
+	})
+
+	heartbeatFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "registry_heartbeat_failures_total",
+		Help: "Total number of failed heartbeat probes, by service.",
+	}, []string{"service"})
+
+	notifyDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name: "registry_notify_duration_seconds",
+		Help: "Time spent dispatching a registry change to dependents.",
+	})
+
+	activeServices = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "registry_active_services",
+		Help: "Number of instances currently registered, by service name.",
+	}, []string{"name"})
+)
+
+// recordAdd and recordRemove keep registry_active_services and
+// registry_registrations_total in step with the registations map; call
+// them exactly once per successful add/remove.
+func recordAdd(name ServiceName) {
+	registrationsTotal.Inc()
+	activeServices.WithLabelValues(string(name)).Inc()
+}
+
+func recordRemove(name ServiceName) {
+	activeServices.WithLabelValues(string(name)).Dec()
+}
+
+func recordHeartbeatFailure(name ServiceName) {
+	heartbeatFailuresTotal.WithLabelValues(string(name)).Inc()
+}
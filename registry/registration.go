@@ -0,0 +1,93 @@
+package registry
+
+// ServiceName identifies a logical service. Multiple instances can be
+// registered under the same ServiceName so that callers can be load
+// balanced across them.
+type ServiceName string
+
+const (
+	LogService ServiceName = "LogService"
+)
+
+// Selector describes which service instances a dependent wants to be
+// notified about: a ServiceName plus optional version and tag
+// constraints, rather than just a bare name. This is what lets two
+// versions of the same service (e.g. a canary and the stable release)
+// coexist in the hub while each dependent only hears about the instances
+// it actually wants.
+type Selector struct {
+	Name ServiceName
+	// VersionConstraint is matched against an instance's Version; see
+	// matchesVersionConstraint for the supported syntax ("^1.2.3",
+	// "~1.2.3", ">=1.2.3", "=1.2.3"/"1.2.3"). Empty matches any version.
+	VersionConstraint string
+	// Tags must all be present on an instance's Tags for it to match.
+	Tags []string
+}
+
+// matches reports whether reg satisfies s.
+func (s Selector) matches(reg *Registration) bool {
+	return s.matchesEntry(PatchEntry{Name: reg.ServiceName, Version: reg.Version, Tags: reg.Tags})
+}
+
+// matchesEntry reports whether a PatchEntry (which carries the same
+// Version/Tags an instance registered with) satisfies s.
+func (s Selector) matchesEntry(e PatchEntry) bool {
+	if e.Name != s.Name {
+		return false
+	}
+	if !matchesVersionConstraint(e.Version, s.VersionConstraint) {
+		return false
+	}
+	for _, tag := range s.Tags {
+		if !hasTag(e.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Registration describes a single running instance of a service as it
+// registers itself with the hub.
+type Registration struct {
+	ServiceName      ServiceName
+	ServiceUrl       string
+	RequiredServices []Selector
+	ServiceUpdateUrl string
+	HeartbeatUrl     string
+	// HealthPolicy configures how this instance is probed. Zero-value
+	// fields fall back to sane defaults; see HealthPolicy.withDefaults.
+	HealthPolicy HealthPolicy
+	// Version, Tags and Metadata support blue/green and canary rollouts:
+	// dependents can scope a Selector to a VersionConstraint and/or a set
+	// of Tags instead of just a bare ServiceName.
+	Version  string
+	Tags     []string
+	Metadata map[string]string
+}
+
+// PatchEntry is one add/remove event carried inside a Patch. It carries
+// enough of the instance (Version, Tags) for a Selector to be matched
+// against it without a second lookup.
+type PatchEntry struct {
+	Name    ServiceName
+	Url     string
+	Version string
+	Tags    []string
+}
+
+// Patch is the payload pushed to dependents whenever the set of registered
+// service instances changes.
+type Patch struct {
+	Added   []PatchEntry
+	Removed []PatchEntry
+}
@@ -0,0 +1,9 @@
+// Package rpc implements the gRPC transport defined in ../registry.proto
+// alongside the existing HTTP/JSON registry.RegistrationService. The
+// message and service types (RegisterRequest, RegistryServer,
+// Registry_WatchServer, ...) are produced by protoc-gen-go and
+// protoc-gen-go-grpc from that file; server.go contains only the
+// hand-written service logic that sits on top of them.
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative -I .. ../registry.proto
@@ -0,0 +1,126 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+
+	"distributions/registry"
+)
+
+// Server implements RegistryServer against the same in-process hub the
+// HTTP RegistrationService uses, so gRPC and HTTP/JSON clients see one
+// consistent registry.
+type Server struct {
+	UnimplementedRegistryServer
+}
+
+// Register adds the dependent to the hub and replies with whatever
+// instances are already known for its RequiredServices. The dependent is
+// expected to call Watch on the same service_url afterwards to keep
+// receiving updates, rather than exposing its own callback URL.
+func (s *Server) Register(ctx context.Context, req *RegisterRequest) (*RegisterResponse, error) {
+	required := make([]registry.Selector, len(req.RequiredServices))
+	for i, sel := range req.RequiredServices {
+		required[i] = registry.Selector{
+			Name:              registry.ServiceName(sel.Name),
+			VersionConstraint: sel.VersionConstraint,
+			Tags:              sel.Tags,
+		}
+	}
+
+	watcher := registry.NewWatcher(req.ServiceUrl)
+	registry.AddWatcher(watcher)
+
+	err := registry.Register(registry.Registration{
+		ServiceName:      registry.ServiceName(req.ServiceName),
+		ServiceUrl:       req.ServiceUrl,
+		RequiredServices: required,
+		HeartbeatUrl:     req.HeartbeatUrl,
+		Version:          req.Version,
+		Tags:             req.Tags,
+		Metadata:         req.Metadata,
+	})
+	if err != nil {
+		registry.RemoveWatcher(req.ServiceUrl)
+		return nil, err
+	}
+
+	return &RegisterResponse{Required: drainPending(watcher)}, nil
+}
+
+// Deregister evicts the instance at req.ServiceUrl from the hub.
+func (s *Server) Deregister(ctx context.Context, req *DeregisterRequest) (*DeregisterResponse, error) {
+	if err := registry.Remove(req.ServiceUrl); err != nil {
+		return nil, err
+	}
+	return &DeregisterResponse{}, nil
+}
+
+// Watch streams patches to the dependent that registered at
+// req.ServiceUrl until the client disconnects or the dependent's Watcher is
+// removed with registry.RemoveWatcher, replacing the push-based sendPatch
+// HTTP callback with a single long-lived connection the dependent doesn't
+// need to expose anything for. Deregistering the dependent does not by
+// itself end the stream.
+func (s *Server) Watch(req *WatchRequest, stream Registry_WatchServer) error {
+	watcher := registry.WatcherFor(req.ServiceUrl)
+	if watcher == nil {
+		return fmt.Errorf("no registration found for %s, call Register first", req.ServiceUrl)
+	}
+	defer registry.RemoveWatcher(req.ServiceUrl)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case p, ok := <-watcher.Patches():
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(patchToProto(p)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Resolve picks one instance of req.ServiceName using req.Strategy.
+func (s *Server) Resolve(ctx context.Context, req *ResolveRequest) (*ResolveResponse, error) {
+	instance := registry.Resolve(registry.ServiceName(req.ServiceName), registry.Strategy(req.Strategy))
+	if instance == nil {
+		return nil, fmt.Errorf("no instance available for %s", req.ServiceName)
+	}
+	return &ResolveResponse{ServiceUrl: instance.ServiceUrl}, nil
+}
+
+// drainPending collects whatever patches are already buffered on watcher
+// without blocking, folding them into the Patch returned by Register so a
+// freshly-registered dependent doesn't have to wait for its first Watch
+// call to learn about already-running instances.
+func drainPending(watcher *registry.Watcher) *Patch {
+	p := &Patch{}
+	for {
+		select {
+		case patch := <-watcher.Patches():
+			merged := patchToProto(patch)
+			p.Added = append(p.Added, merged.Added...)
+			p.Removed = append(p.Removed, merged.Removed...)
+		default:
+			return p
+		}
+	}
+}
+
+func patchToProto(p registry.Patch) *Patch {
+	out := &Patch{
+		Added:   make([]*PatchEntry, len(p.Added)),
+		Removed: make([]*PatchEntry, len(p.Removed)),
+	}
+	for i, e := range p.Added {
+		out.Added[i] = &PatchEntry{Name: string(e.Name), Url: e.Url, Version: e.Version, Tags: e.Tags}
+	}
+	for i, e := range p.Removed {
+		out.Removed[i] = &PatchEntry{Name: string(e.Name), Url: e.Url, Version: e.Version, Tags: e.Tags}
+	}
+	return out
+}
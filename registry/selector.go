@@ -0,0 +1,76 @@
+package registry
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Strategy identifies how a single instance is picked out of the set of
+// instances registered for a given service.
+type Strategy string
+
+const (
+	RoundRobin        Strategy = "round-robin"
+	Random            Strategy = "random"
+	LeastRecentlyUsed Strategy = "least-recently-used"
+)
+
+// instanceSelector picks one Registration out of a set of candidates
+// according to a Strategy. It keeps just enough state (round-robin cursors
+// per service, last-used timestamps per instance) to make that choice
+// without callers having to track it themselves.
+type instanceSelector struct {
+	mutex      sync.Mutex
+	cursors    map[ServiceName]int
+	lastUsedAt map[string]time.Time
+}
+
+func newInstanceSelector() *instanceSelector {
+	return &instanceSelector{
+		cursors:    make(map[ServiceName]int),
+		lastUsedAt: make(map[string]time.Time),
+	}
+}
+
+// forget drops any state kept for url, called once an instance is removed
+// from the registry so its last-used time isn't kept; an instance later
+// registered again at url is treated as never used.
+func (s *instanceSelector) forget(url string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.lastUsedAt, url)
+}
+
+// Select returns one of instances for name according to strategy. It
+// returns nil if instances is empty. An unrecognised strategy falls back to
+// RoundRobin.
+func (s *instanceSelector) Select(name ServiceName, instances []*Registration, strategy Strategy) *Registration {
+	if len(instances) == 0 {
+		return nil
+	}
+
+	switch strategy {
+	case Random:
+		return instances[rand.Intn(len(instances))]
+	case LeastRecentlyUsed:
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		oldest := instances[0]
+		oldestAt := s.lastUsedAt[oldest.ServiceUrl]
+		for _, inst := range instances[1:] {
+			if at := s.lastUsedAt[inst.ServiceUrl]; at.Before(oldestAt) {
+				oldest = inst
+				oldestAt = at
+			}
+		}
+		s.lastUsedAt[oldest.ServiceUrl] = time.Now()
+		return oldest
+	default:
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		i := s.cursors[name] % len(instances)
+		s.cursors[name] = i + 1
+		return instances[i]
+	}
+}
@@ -0,0 +1,65 @@
+package registry
+
+import "testing"
+
+func TestInstanceSelectorRoundRobin(t *testing.T) {
+	s := newInstanceSelector()
+	instances := []*Registration{
+		{ServiceName: "svc", ServiceUrl: "http://a"},
+		{ServiceName: "svc", ServiceUrl: "http://b"},
+		{ServiceName: "svc", ServiceUrl: "http://c"},
+	}
+
+	var got []string
+	for i := 0; i < len(instances)*2; i++ {
+		got = append(got, s.Select("svc", instances, RoundRobin).ServiceUrl)
+	}
+
+	want := []string{"http://a", "http://b", "http://c", "http://a", "http://b", "http://c"}
+	for i, url := range want {
+		if got[i] != url {
+			t.Fatalf("pick %d = %s, want %s (got sequence %v)", i, got[i], url, got)
+		}
+	}
+}
+
+func TestInstanceSelectorLeastRecentlyUsed(t *testing.T) {
+	s := newInstanceSelector()
+	instances := []*Registration{
+		{ServiceName: "svc", ServiceUrl: "http://a"},
+		{ServiceName: "svc", ServiceUrl: "http://b"},
+	}
+
+	first := s.Select("svc", instances, LeastRecentlyUsed)
+	second := s.Select("svc", instances, LeastRecentlyUsed)
+	if first.ServiceUrl == second.ServiceUrl {
+		t.Fatalf("expected distinct instances, got %s twice", first.ServiceUrl)
+	}
+
+	third := s.Select("svc", instances, LeastRecentlyUsed)
+	if third.ServiceUrl != first.ServiceUrl {
+		t.Fatalf("expected least-recently-used to cycle back to %s, got %s", first.ServiceUrl, third.ServiceUrl)
+	}
+}
+
+func TestInstanceSelectorForget(t *testing.T) {
+	s := newInstanceSelector()
+	instances := []*Registration{
+		{ServiceName: "svc", ServiceUrl: "http://a"},
+		{ServiceName: "svc", ServiceUrl: "http://b"},
+	}
+
+	s.Select("svc", instances, LeastRecentlyUsed)
+	s.forget("http://a")
+
+	if _, ok := s.lastUsedAt["http://a"]; ok {
+		t.Fatalf("forget did not drop state for http://a")
+	}
+}
+
+func TestInstanceSelectorEmpty(t *testing.T) {
+	s := newInstanceSelector()
+	if got := s.Select("svc", nil, RoundRobin); got != nil {
+		t.Fatalf("Select with no instances = %v, want nil", got)
+	}
+}
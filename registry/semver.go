@@ -0,0 +1,79 @@
+package registry
+
+import (
+	"strconv"
+	"strings"
+)
+
+// semver is a minimal (major.minor.patch) parsed version - just enough to
+// support the VersionConstraint syntax Selector accepts.
+type semver struct {
+	major, minor, patch int
+}
+
+func parseSemver(v string) (semver, bool) {
+	v = strings.TrimPrefix(v, "v")
+	parts := strings.SplitN(v, ".", 3)
+
+	var sv semver
+	var err error
+	if len(parts) > 0 && parts[0] != "" {
+		if sv.major, err = strconv.Atoi(parts[0]); err != nil {
+			return semver{}, false
+		}
+	}
+	if len(parts) > 1 {
+		if sv.minor, err = strconv.Atoi(parts[1]); err != nil {
+			return semver{}, false
+		}
+	}
+	if len(parts) > 2 {
+		if sv.patch, err = strconv.Atoi(parts[2]); err != nil {
+			return semver{}, false
+		}
+	}
+	return sv, true
+}
+
+func (v semver) less(other semver) bool {
+	if v.major != other.major {
+		return v.major < other.major
+	}
+	if v.minor != other.minor {
+		return v.minor < other.minor
+	}
+	return v.patch < other.patch
+}
+
+// matchesVersionConstraint reports whether version satisfies constraint.
+// Supported forms: "" (always matches), "^1.2.3" (same major, >= given
+// minor.patch), "~1.2.3" (same major.minor, >= given patch), ">=1.2.3",
+// and "=1.2.3" or a bare "1.2.3" (exact match).
+func matchesVersionConstraint(version, constraint string) bool {
+	if constraint == "" {
+		return true
+	}
+
+	v, ok := parseSemver(version)
+	if !ok {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(constraint, "^"):
+		c, ok := parseSemver(constraint[1:])
+		return ok && v.major == c.major && !v.less(c)
+	case strings.HasPrefix(constraint, "~"):
+		c, ok := parseSemver(constraint[1:])
+		return ok && v.major == c.major && v.minor == c.minor && !v.less(c)
+	case strings.HasPrefix(constraint, ">="):
+		c, ok := parseSemver(constraint[2:])
+		return ok && !v.less(c)
+	case strings.HasPrefix(constraint, "="):
+		c, ok := parseSemver(constraint[1:])
+		return ok && v == c
+	default:
+		c, ok := parseSemver(constraint)
+		return ok && v == c
+	}
+}
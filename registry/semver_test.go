@@ -0,0 +1,33 @@
+package registry
+
+import "testing"
+
+func TestMatchesVersionConstraint(t *testing.T) {
+	cases := []struct {
+		version    string
+		constraint string
+		want       bool
+	}{
+		{"1.2.3", "", true},
+		{"1.2.3", "1.2.3", true},
+		{"1.2.4", "1.2.3", false},
+		{"1.2.3", "=1.2.3", true},
+		{"1.2.4", "=1.2.3", false},
+		{"1.3.0", "^1.2.3", true},
+		{"1.2.3", "^1.2.3", true},
+		{"2.0.0", "^1.2.3", false},
+		{"1.2.9", "~1.2.3", true},
+		{"1.3.0", "~1.2.3", false},
+		{"1.2.3", ">=1.2.3", true},
+		{"1.2.2", ">=1.2.3", false},
+		{"2.0.0", ">=1.2.3", true},
+		{"not-a-version", "1.2.3", false},
+		{"1.2.3", "not-a-version", false},
+	}
+
+	for _, c := range cases {
+		if got := matchesVersionConstraint(c.version, c.constraint); got != c.want {
+			t.Errorf("matchesVersionConstraint(%q, %q) = %v, want %v", c.version, c.constraint, got, c.want)
+		}
+	}
+}
@@ -2,95 +2,223 @@ package registry
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"sync"
-	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 const ExportServerPort = ":3000"
 const ExportServersUrl = "http://localhost" + ExportServerPort + "/services"
 
 type registry struct {
-	registations []Registration
+	registations map[ServiceName][]*Registration
 	mutex        *sync.RWMutex
+	selector     *instanceSelector
+	store        Store
+	checkers     map[string]*healthChecker
+	cancels      map[string]context.CancelFunc
+	watchers     map[string]*Watcher
 }
 
 func (r *registry) add(reg Registration) error {
 	log.Printf("添加服务 Add Service:%v with Url:%s\n", reg.ServiceName, reg.ServiceUrl)
 	// 注册服务
 	r.mutex.Lock()
-	r.registations = append(r.registations, reg)
+	r.registations[reg.ServiceName] = append(r.registations[reg.ServiceName], &reg)
+	store := r.store
 	r.mutex.Unlock()
+	recordAdd(reg.ServiceName)
+	if store != nil {
+		if err := store.Save(reg); err != nil {
+			log.Println(err)
+		}
+	}
+	r.ensureChecker(reg)
 	// 加载依赖的服务
 	err := r.sendRequiredService(reg)
 	if err != nil {
 		return err
 	}
 	// 服务发现通知
-	r.notify(patch{Added: []patchEntry{
+	r.notify(Patch{Added: []PatchEntry{
 		{
-			Name: reg.ServiceName,
-			Url:  reg.ServiceUrl,
+			Name:    reg.ServiceName,
+			Url:     reg.ServiceUrl,
+			Version: reg.Version,
+			Tags:    reg.Tags,
 		},
 	}})
 	return nil
 }
 
-func (r registry) notify(fullPatch patch) {
+// ensureChecker starts a healthChecker goroutine for reg.ServiceUrl if one
+// isn't already running. It's idempotent so it can safely be called both
+// from add and when restoring a previously persisted registration.
+func (r *registry) ensureChecker(reg Registration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, exists := r.checkers[reg.ServiceUrl]; exists {
+		return
+	}
+
+	checker := newHealthChecker(reg)
+	ctx, cancel := context.WithCancel(context.Background())
+	r.checkers[reg.ServiceUrl] = checker
+	r.cancels[reg.ServiceUrl] = cancel
+	go checker.run(ctx, r)
+}
+
+// stopChecker cancels and forgets the healthChecker running for url, if
+// any.
+func (r *registry) stopChecker(url string) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	for _, reg := range r.registations {
-		go func(reg Registration) {
-			for _, reqSrvName := range reg.RequiredServices {
-				p := new(patch)
-				p.Added = []patchEntry{}
-				p.Removed = []patchEntry{}
-
-				sendUpdate := false
-
-				for _, added := range fullPatch.Added {
-					if added.Name == reqSrvName {
-						p.Added = append(p.Added, added)
-						sendUpdate = true
+	if cancel, ok := r.cancels[url]; ok {
+		cancel()
+		delete(r.cancels, url)
+		delete(r.checkers, url)
+	}
+}
+
+// healthSnapshot reports the current HealthState of every registered
+// instance, "unknown" for any that somehow has no checker running.
+func (r *registry) healthSnapshot() []HealthSnapshot {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var out []HealthSnapshot
+	for name, instances := range r.registations {
+		for _, inst := range instances {
+			state := "unknown"
+			if checker, ok := r.checkers[inst.ServiceUrl]; ok {
+				state = checker.State().String()
+			}
+			out = append(out, HealthSnapshot{ServiceName: name, Url: inst.ServiceUrl, State: state})
+		}
+	}
+	return out
+}
+
+// HealthSnapshot is one instance's reported health, as served by
+// GET /services/health.
+type HealthSnapshot struct {
+	ServiceName ServiceName `json:"serviceName"`
+	Url         string      `json:"url"`
+	State       string      `json:"state"`
+}
+
+// instances returns a snapshot of the instances currently registered for
+// name, or an empty slice if none are registered.
+func (r *registry) instances(name ServiceName) []*Registration {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	instances := r.registations[name]
+	out := make([]*Registration, len(instances))
+	copy(out, instances)
+	return out
+}
+
+// query returns every instance of selector.Name whose Version and Tags
+// satisfy selector, for POST /services/query.
+func (r *registry) query(selector Selector) []*Registration {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var out []*Registration
+	for _, inst := range r.registations[selector.Name] {
+		if selector.matches(inst) {
+			out = append(out, inst)
+		}
+	}
+	return out
+}
+
+func (r *registry) notify(fullPatch Patch) {
+	timer := prometheus.NewTimer(notifyDuration)
+	defer timer.ObserveDuration()
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for _, instances := range r.registations {
+		for _, instance := range instances {
+			go func(reg Registration) {
+				for _, selector := range reg.RequiredServices {
+					p := new(Patch)
+					p.Added = []PatchEntry{}
+					p.Removed = []PatchEntry{}
+
+					sendUpdate := false
+
+					for _, added := range fullPatch.Added {
+						if selector.matchesEntry(added) {
+							p.Added = append(p.Added, added)
+							sendUpdate = true
+						}
 					}
-				}
-				for _, removed := range fullPatch.Removed {
-					if removed.Name == reqSrvName {
-						p.Removed = append(p.Removed, removed)
-						sendUpdate = true
+					for _, removed := range fullPatch.Removed {
+						// A removal is propagated for any watched
+						// ServiceName regardless of version/tag
+						// constraints - the instance is gone either way.
+						if removed.Name == selector.Name {
+							p.Removed = append(p.Removed, removed)
+							sendUpdate = true
+						}
 					}
-				}
-				// 发送通知
-				if sendUpdate {
-					err := r.sendPatch(*p, reg.ServiceUpdateUrl)
-					if err != nil {
+					// 发送通知
+					if !sendUpdate {
+						continue
+					}
+					if w := r.watcher(reg.ServiceUrl); w != nil {
+						select {
+						case w.patches <- *p:
+						default:
+							log.Printf("watcher for %s is falling behind, dropping patch\n", reg.ServiceUrl)
+						}
+						continue
+					}
+					if err := r.sendPatch(*p, reg.ServiceUpdateUrl); err != nil {
 						log.Println(err)
 						return
 					}
 				}
-			}
-		}(reg)
+			}(*instance)
+		}
 	}
 }
 
-func (r registry) sendRequiredService(reg Registration) error {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
-	var p patch
-	for _, serviceReg := range r.registations {
-		for _, serviceReq := range reg.RequiredServices {
-			if serviceReg.ServiceName == serviceReq {
-				p.Added = append(p.Added, patchEntry{
-					Name: serviceReg.ServiceName,
-					Url:  serviceReg.ServiceUrl,
-				})
+func (r *registry) sendRequiredService(reg Registration) error {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	var p Patch
+	for _, instances := range r.registations {
+		for _, serviceReg := range instances {
+			for _, selector := range reg.RequiredServices {
+				if selector.matches(serviceReg) {
+					p.Added = append(p.Added, PatchEntry{
+						Name:    serviceReg.ServiceName,
+						Url:     serviceReg.ServiceUrl,
+						Version: serviceReg.Version,
+						Tags:    serviceReg.Tags,
+					})
+				}
 			}
 		}
 	}
+	if w := r.watcher(reg.ServiceUrl); w != nil {
+		select {
+		case w.patches <- p:
+		default:
+			log.Printf("watcher for %s is falling behind, dropping patch\n", reg.ServiceUrl)
+		}
+		return nil
+	}
+
 	err := r.sendPatch(p, reg.ServiceUpdateUrl)
 	if err != nil {
 		return err
@@ -98,12 +226,22 @@ func (r registry) sendRequiredService(reg Registration) error {
 	return nil
 }
 
-func (r registry) sendPatch(p patch, url string) error {
+func (r *registry) sendPatch(p Patch, url string) error {
 	pJson, err := json.Marshal(p)
 	if err != nil {
 		return err
 	}
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(pJson))
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(pJson))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	_, span := startOutboundSpan(req.Context(), "registry.sendPatch", req)
+	defer span.End()
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -114,67 +252,101 @@ func (r registry) sendPatch(p patch, url string) error {
 }
 
 func (r *registry) remove(url string) error {
-	for i, srv := range reg.registations {
-		if srv.ServiceUrl == url {
-			reg.notify(patch{
-				Removed: []patchEntry{
-					{
-						Name: srv.ServiceName,
-						Url:  srv.ServiceUrl,
-					},
-				},
-			})
-			r.mutex.Lock()
-			reg.registations = append(reg.registations[:i], r.registations[i+1:]...)
-			r.mutex.Unlock()
+	r.mutex.Lock()
+	var removed *Registration
+	for name, instances := range r.registations {
+		for i, srv := range instances {
+			if srv.ServiceUrl == url {
+				removed = srv
+				r.registations[name] = append(instances[:i], instances[i+1:]...)
+				break
+			}
+		}
+		if removed != nil {
+			break
 		}
 	}
-	return nil
-}
+	store := r.store
+	r.mutex.Unlock()
 
-func (r registry) heartbeat(sec time.Duration) {
-	for {
-		var wg sync.WaitGroup
-		for _, reg := range reg.registations {
-			wg.Add(1)
-			go func(reg Registration) {
-				defer wg.Done()
-				success := true
-			loop:
-				for attemps := 0; attemps < 3; attemps++ {
-					resp, err := http.Get(reg.HeartbeatUrl)
-					if resp.StatusCode == http.StatusOK {
-						fmt.Printf("心跳检测 heartbeat check passed for service %v\n", reg.ServiceName)
-						if !success {
-							r.add(reg)
-						}
-						break loop
-					}
-					fmt.Printf("心跳检测 heartbeat check failed for service %v \n", reg.ServiceName)
-					if err != nil {
-						log.Println(err)
-					}
-					success = false
-					r.remove(reg.ServiceUrl)
-					time.Sleep(time.Second)
-				}
-			}(reg)
+	if removed == nil {
+		return nil
+	}
+
+	if store != nil {
+		if err := store.Delete(url); err != nil {
+			log.Println(err)
 		}
-		wg.Wait()
-		time.Sleep(sec)
 	}
+	r.stopChecker(url)
+	r.selector.forget(url)
+	recordRemove(removed.ServiceName)
+	r.notify(Patch{
+		Removed: []PatchEntry{
+			{
+				Name:    removed.ServiceName,
+				Url:     removed.ServiceUrl,
+				Version: removed.Version,
+				Tags:    removed.Tags,
+			},
+		},
+	})
+	return nil
 }
 
+// HandleHeartbeat starts a healthChecker for every instance currently in
+// the registry that doesn't already have one running. add() and Restore
+// both start a checker for every instance they put in the table, so for
+// those instances this is a no-op (ensureChecker is idempotent); it only
+// starts checkers for instances that reached the table some other way.
 func HandleHeartbeat() {
-	var once sync.Once
-	once.Do(func() {
-		go reg.heartbeat(3 * time.Second)
-	})
+	reg.mutex.RLock()
+	var all []Registration
+	for _, instances := range reg.registations {
+		for _, instance := range instances {
+			all = append(all, *instance)
+		}
+	}
+	reg.mutex.RUnlock()
+
+	for _, serviceReg := range all {
+		reg.ensureChecker(serviceReg)
+	}
 }
 
 var reg = registry{
-	registations: make([]Registration, 0),
+	registations: make(map[ServiceName][]*Registration),
 	mutex:        new(sync.RWMutex),
+	selector:     newInstanceSelector(),
+	checkers:     make(map[string]*healthChecker),
+	cancels:      make(map[string]context.CancelFunc),
+	watchers:     make(map[string]*Watcher),
+}
+
+// Register adds reg to the hub, exactly as POST /services does, and is
+// exported so alternate transports (see registry/rpc) can register
+// dependents through the same path.
+func Register(r Registration) error {
+	return reg.add(r)
+}
+
+// Remove evicts the instance at url from the hub, exactly as DELETE
+// /services does.
+func Remove(url string) error {
+	return reg.remove(url)
+}
+
+// Resolve returns one instance of name chosen by strategy, or nil if none
+// is registered. An empty strategy returns an arbitrary instance.
+func Resolve(name ServiceName, strategy Strategy) *Registration {
+	instances := reg.instances(name)
+	if len(instances) == 0 {
+		return nil
+	}
+	if strategy == "" {
+		return instances[0]
+	}
+	return reg.selector.Select(name, instances, strategy)
 }
 
 type RegistrationService struct{}
@@ -184,21 +356,45 @@ func (s RegistrationService) ServeHTTP(rw http.ResponseWriter, r *http.Request)
 	switch r.Method {
 	case http.MethodPost:
 		dec := json.NewDecoder(r.Body)
-		var r Registration
-		err := dec.Decode(&r)
+		var registration Registration
+		err := dec.Decode(&registration)
 		if err != nil {
 			log.Println(err)
 			rw.WriteHeader(http.StatusBadRequest)
 			return
 		}
 		// 服务注册
-		err = reg.add(r)
+		err = reg.add(registration)
 
 		if err != nil {
 			log.Println(err)
 			rw.WriteHeader(http.StatusBadRequest)
 			return
 		}
+	case http.MethodGet:
+		// GET /services?name=X[&strategy=round-robin|random|least-recently-used]
+		name := ServiceName(r.URL.Query().Get("name"))
+		if name == "" {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		instances := reg.instances(name)
+		if len(instances) == 0 {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		if strategy := r.URL.Query().Get("strategy"); strategy != "" {
+			picked := reg.selector.Select(name, instances, Strategy(strategy))
+			if picked == nil {
+				rw.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(rw).Encode(picked)
+			return
+		}
+		json.NewEncoder(rw).Encode(instances)
 	case http.MethodDelete:
 		payload, err := ioutil.ReadAll(r.Body)
 		if err != nil {
@@ -218,3 +414,37 @@ func (s RegistrationService) ServeHTTP(rw http.ResponseWriter, r *http.Request)
 		return
 	}
 }
+
+// HealthService serves GET /services/health, reporting every registered
+// instance's current HealthState.
+type HealthService struct{}
+
+func (HealthService) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(reg.healthSnapshot())
+}
+
+// QueryService serves POST /services/query: the request body is a JSON
+// Selector, and the response is every instance matching it.
+type QueryService struct{}
+
+func (QueryService) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var selector Selector
+	if err := json.NewDecoder(r.Body).Decode(&selector); err != nil {
+		log.Println(err)
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(reg.query(selector))
+}
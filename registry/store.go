@@ -0,0 +1,75 @@
+package registry
+
+import (
+	"context"
+	"log"
+	"net/http"
+)
+
+// Store persists registrations so the hub can recover its table after a
+// restart instead of forcing every dependent to re-register from scratch.
+// Implementations only need to track the latest known state per
+// ServiceUrl; the registry itself still owns notification and health
+// checking.
+type Store interface {
+	Save(reg Registration) error
+	Delete(url string) error
+	LoadAll() ([]Registration, error)
+}
+
+// SetStore wires s into the registry so future add/remove calls persist
+// through it. Passing nil disables persistence.
+func SetStore(s Store) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	reg.store = s
+}
+
+// Restore loads previously persisted registrations from s and re-probes
+// each one's HeartbeatUrl before accepting it back into the table, so a
+// hub that crashed with stale entries in the store doesn't resurrect dead
+// services. Entries that fail the probe are evicted from s as well.
+func Restore(s Store) error {
+	entries, err := s.LoadAll()
+	if err != nil {
+		return err
+	}
+
+	for i := range entries {
+		r := entries[i]
+		if !restoreProbe(r) {
+			log.Printf("剔除失效服务 evicting stale service %v at %s on restore\n", r.ServiceName, r.ServiceUrl)
+			s.Delete(r.ServiceUrl)
+			continue
+		}
+
+		reg.mutex.Lock()
+		reg.registations[r.ServiceName] = append(reg.registations[r.ServiceName], &r)
+		reg.mutex.Unlock()
+		recordAdd(r.ServiceName)
+		reg.ensureChecker(r)
+	}
+	return nil
+}
+
+// restoreProbe re-checks r.HeartbeatUrl with the same per-request timeout
+// healthChecker.probe uses, so a host that accepts the connection but never
+// responds can't hang Restore (and the registry's startup) indefinitely.
+func restoreProbe(r Registration) bool {
+	policy := r.HealthPolicy.withDefaults()
+	ctx, cancel := context.WithTimeout(context.Background(), policy.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.HeartbeatUrl, nil)
+	if err != nil {
+		return false
+	}
+
+	client := &http.Client{Timeout: policy.Timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
@@ -0,0 +1,69 @@
+package registry
+
+import (
+	"encoding/json"
+
+	"go.etcd.io/bbolt"
+)
+
+// boltRegistrationsBucket is the single bucket the bolt-backed store keeps
+// all registrations in, keyed by ServiceUrl.
+var boltRegistrationsBucket = []byte("registrations")
+
+// boltStore is a Store backed by a single BoltDB (bbolt) file. It trades
+// the JSON log's append-then-compact cycle for a real key/value store, at
+// the cost of the extra dependency.
+type boltStore struct {
+	db *bbolt.DB
+}
+
+// NewBoltStore opens (creating if necessary) a bbolt-backed Store at path.
+func NewBoltStore(path string) (Store, error) {
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltRegistrationsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) Save(reg Registration) error {
+	value, err := json.Marshal(reg)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltRegistrationsBucket).Put([]byte(reg.ServiceUrl), value)
+	})
+}
+
+func (s *boltStore) Delete(url string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltRegistrationsBucket).Delete([]byte(url))
+	})
+}
+
+func (s *boltStore) LoadAll() ([]Registration, error) {
+	var all []Registration
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltRegistrationsBucket).ForEach(func(_, value []byte) error {
+			var reg Registration
+			if err := json.Unmarshal(value, &reg); err != nil {
+				return err
+			}
+			all = append(all, reg)
+			return nil
+		})
+	})
+	return all, err
+}
@@ -0,0 +1,150 @@
+package registry
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+)
+
+// compactionThresholdBytes is how large the append-only log is allowed to
+// grow before jsonFileStore rewrites it down to just the live entries.
+const compactionThresholdBytes = 64 * 1024
+
+// jsonFileStore is the default Store: an append-only, newline-delimited
+// JSON log of save/delete events, periodically compacted down to the
+// latest registration per ServiceUrl.
+type jsonFileStore struct {
+	path  string
+	mutex sync.Mutex
+}
+
+// jsonLogEntry is one line of the log: either a save of Registration, or a
+// tombstone marking Url as removed.
+type jsonLogEntry struct {
+	Url          string        `json:"url"`
+	Deleted      bool          `json:"deleted,omitempty"`
+	Registration *Registration `json:"registration,omitempty"`
+}
+
+// NewJSONFileStore opens (creating if necessary) a JSON-backed Store
+// rooted at path.
+func NewJSONFileStore(path string) (Store, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return &jsonFileStore{path: path}, nil
+}
+
+func (s *jsonFileStore) Save(reg Registration) error {
+	return s.append(jsonLogEntry{Url: reg.ServiceUrl, Registration: &reg})
+}
+
+func (s *jsonFileStore) Delete(url string) error {
+	return s.append(jsonLogEntry{Url: url, Deleted: true})
+}
+
+func (s *jsonFileStore) LoadAll() ([]Registration, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	latest, err := s.replay()
+	if err != nil {
+		return nil, err
+	}
+
+	all := make([]Registration, 0, len(latest))
+	for _, reg := range latest {
+		all = append(all, *reg)
+	}
+	return all, nil
+}
+
+func (s *jsonFileStore) append(entry jsonLogEntry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := json.NewEncoder(f).Encode(entry); err != nil {
+		return err
+	}
+
+	return s.compactIfNeeded()
+}
+
+// replay reads the log top to bottom and folds it down to the latest
+// registration known per ServiceUrl.
+func (s *jsonFileStore) replay() (map[string]*Registration, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]*Registration{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	latest := make(map[string]*Registration)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry jsonLogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Printf("跳过损坏的日志行 skipping corrupt log line in %s: %v\n", s.path, err)
+			continue
+		}
+		if entry.Deleted {
+			delete(latest, entry.Url)
+			continue
+		}
+		latest[entry.Url] = entry.Registration
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return latest, nil
+}
+
+// compactIfNeeded rewrites the log to contain only the live entries once it
+// has grown past compactionThresholdBytes, so a long-running hub doesn't
+// accumulate an unbounded history of save/delete events. Caller must hold
+// s.mutex.
+func (s *jsonFileStore) compactIfNeeded() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	if info.Size() < compactionThresholdBytes {
+		return nil
+	}
+
+	latest, err := s.replay()
+	if err != nil {
+		return err
+	}
+
+	tmpPath := s.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(tmp)
+	for url, r := range latest {
+		if err := enc.Encode(jsonLogEntry{Url: url, Registration: r}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, s.path)
+}
@@ -0,0 +1,103 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSONFileStoreSaveDeleteLoadAll(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	s, err := NewJSONFileStore(path)
+	if err != nil {
+		t.Fatalf("NewJSONFileStore: %v", err)
+	}
+
+	if err := s.Save(Registration{ServiceName: "a", ServiceUrl: "http://a"}); err != nil {
+		t.Fatalf("Save a: %v", err)
+	}
+	if err := s.Save(Registration{ServiceName: "b", ServiceUrl: "http://b"}); err != nil {
+		t.Fatalf("Save b: %v", err)
+	}
+	if err := s.Delete("http://a"); err != nil {
+		t.Fatalf("Delete a: %v", err)
+	}
+
+	all, err := s.LoadAll()
+	if err != nil {
+		t.Fatalf("LoadAll: %v", err)
+	}
+	if len(all) != 1 || all[0].ServiceUrl != "http://b" {
+		t.Fatalf("LoadAll = %v, want only http://b", all)
+	}
+}
+
+func TestJSONFileStoreSkipsCorruptLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	s, err := NewJSONFileStore(path)
+	if err != nil {
+		t.Fatalf("NewJSONFileStore: %v", err)
+	}
+
+	if err := s.Save(Registration{ServiceName: "a", ServiceUrl: "http://a"}); err != nil {
+		t.Fatalf("Save a: %v", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("open for corrupt append: %v", err)
+	}
+	if _, err := f.WriteString("{not valid json\n"); err != nil {
+		t.Fatalf("write corrupt line: %v", err)
+	}
+	f.Close()
+
+	if err := s.Save(Registration{ServiceName: "b", ServiceUrl: "http://b"}); err != nil {
+		t.Fatalf("Save b: %v", err)
+	}
+
+	all, err := s.LoadAll()
+	if err != nil {
+		t.Fatalf("LoadAll: %v", err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("LoadAll = %v, want both entries despite the corrupt line between them", all)
+	}
+}
+
+func TestJSONFileStoreCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	store, err := NewJSONFileStore(path)
+	if err != nil {
+		t.Fatalf("NewJSONFileStore: %v", err)
+	}
+	s := store.(*jsonFileStore)
+
+	// Write enough repeated saves of a single url to push the log past
+	// compactionThresholdBytes, then confirm replay still reflects just the
+	// latest state once compaction has rewritten the file.
+	for i := 0; i < 2000; i++ {
+		if err := s.Save(Registration{ServiceName: "a", ServiceUrl: "http://a", Version: "stale"}); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	if err := s.Save(Registration{ServiceName: "a", ServiceUrl: "http://a", Version: "latest"}); err != nil {
+		t.Fatalf("final Save: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if info.Size() >= compactionThresholdBytes {
+		t.Fatalf("log file is %d bytes, expected compaction to have kept it under %d", info.Size(), compactionThresholdBytes)
+	}
+
+	all, err := s.LoadAll()
+	if err != nil {
+		t.Fatalf("LoadAll: %v", err)
+	}
+	if len(all) != 1 || all[0].Version != "latest" {
+		t.Fatalf("LoadAll after compaction = %v, want a single entry with Version \"latest\"", all)
+	}
+}
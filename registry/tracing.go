@@ -0,0 +1,39 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerProvider creates the spans the hub opens around outbound calls
+// (sendPatch, health probes). It defaults to a no-op implementation so
+// the hub pays no tracing cost until an operator wires in a real exporter
+// with SetTracerProvider.
+var tracerProvider trace.TracerProvider = noop.NewTracerProvider()
+
+// SetTracerProvider installs tp as the TracerProvider the hub uses.
+// Passing nil restores the no-op default.
+func SetTracerProvider(tp trace.TracerProvider) {
+	if tp == nil {
+		tp = noop.NewTracerProvider()
+	}
+	tracerProvider = tp
+}
+
+func tracer() trace.Tracer {
+	return tracerProvider.Tracer("distributions/registry")
+}
+
+// startOutboundSpan starts a span named spanName as a child of ctx and
+// sets the resulting traceparent header on req, so the receiving side of
+// sendPatch or a heartbeat probe can continue the same trace. Callers
+// must end the returned span.
+func startOutboundSpan(ctx context.Context, spanName string, req *http.Request) (context.Context, trace.Span) {
+	ctx, span := tracer().Start(ctx, spanName)
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return ctx, span
+}
@@ -0,0 +1,70 @@
+package registry
+
+import "sync"
+
+// Watcher is the channel-based notification sink used by the gRPC Watch
+// RPC: instead of exposing its own ServiceUpdateUrl for the hub to POST
+// to, a gRPC dependent holds a Watcher and ranges over Patches() to
+// receive updates over its single long-lived Watch stream.
+type Watcher struct {
+	url     string
+	patches chan Patch
+	once    sync.Once
+}
+
+func newWatcher(url string) *Watcher {
+	return &Watcher{url: url, patches: make(chan Patch, 16)}
+}
+
+// Patches returns the channel patches matching this watcher's RequiredServices
+// are delivered on. It's closed once the watcher is removed.
+func (w *Watcher) Patches() <-chan Patch {
+	return w.patches
+}
+
+func (w *Watcher) close() {
+	w.once.Do(func() { close(w.patches) })
+}
+
+// NewWatcher returns a Watcher for the dependent registering itself at
+// url. Call AddWatcher before the dependent's Registration is added to the
+// hub, so the initial patch of already-known instances is delivered to the
+// Watcher instead of being POSTed to ServiceUpdateUrl.
+func NewWatcher(url string) *Watcher {
+	return newWatcher(url)
+}
+
+// AddWatcher wires w into the hub so it receives patches for the
+// dependent registered at w's url.
+func AddWatcher(w *Watcher) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	reg.watchers[w.url] = w
+}
+
+// WatcherFor returns the Watcher registered for url, or nil if none is.
+func WatcherFor(url string) *Watcher {
+	return reg.watcher(url)
+}
+
+func (r *registry) watcher(url string) *Watcher {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.watchers[url]
+}
+
+// RemoveWatcher detaches and closes the Watcher registered for url, if
+// any. Callers (the Watch RPC handler) should always call this once their
+// stream ends so a reconnect doesn't find a stale entry.
+func RemoveWatcher(url string) {
+	reg.mutex.Lock()
+	w, ok := reg.watchers[url]
+	if ok {
+		delete(reg.watchers, url)
+	}
+	reg.mutex.Unlock()
+
+	if ok {
+		w.close()
+	}
+}